@@ -1,203 +1,348 @@
 // client/client-bridge.go
 //
 // WebRTC client‐bridge with verbose debug logs:
-//  - Signaling connects, ICE candidates send/receive
-//  - DataChannel opens and logs each capture/read/send
+//  - Signaling connects, joins a room as a publisher, ICE candidates send/receive
+//  - Screen capture is encoded to VP8/H.264 and pushed as a real video track
+//  - One PeerConnection is created per viewer that joins the room
 //  - Helps trace exactly why frames might not flow
 
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"log"
-	"os"
-	"os/exec"
 	"sync"
-	"time"
 
+	"github.com/Eduardo-Sal/Screenshare-App/iceconfig"
 	"github.com/gorilla/websocket"
+	"github.com/pion/mediadevices"
+	"github.com/pion/mediadevices/pkg/codec/vpx"
+	"github.com/pion/mediadevices/pkg/codec/x264"
+	_ "github.com/pion/mediadevices/pkg/driver/screen" // registers the screen capture driver
+	"github.com/pion/mediadevices/pkg/prop"
 	"github.com/pion/webrtc/v3"
 )
 
 var (
 	signalURL     = flag.String("signal", "ws://localhost:8000/ws", "WebSocket signaling server URL")
-	turnServerURL = flag.String("turn", "", "TURN server URL (e.g., turn:host:3478)")
+	room          = flag.String("room", "default", "signaling room to publish into")
+	iceConfigPath = flag.String("ice-config", "", "path to a JSON file of ICE servers (overridden by what the signaling server hands us on join)")
+	turnServerURL = flag.String("turn", "", "TURN server URL (e.g., turn:host:3478), used only if -ice-config is unset")
 	turnUser      = flag.String("turn-user", "", "TURN username")
 	turnPass      = flag.String("turn-pass", "", "TURN password")
+
+	codecName = flag.String("codec", "vp8", "video codec to encode with: vp8 or h264")
+	width     = flag.Int("width", 1280, "capture width")
+	height    = flag.Int("height", 720, "capture height")
+	frameRate = flag.Float64("framerate", 30, "capture frame rate")
+	bitRate   = flag.Int("bitrate", 1_000_000, "target encoder bitrate in bits/sec")
 )
 
+// Message mirrors the signaling server's envelope (see signaling.go).
+type Message struct {
+	Type       string             `json:"type"`
+	Room       string             `json:"room,omitempty"`
+	Role       string             `json:"role,omitempty"`
+	PeerID     string             `json:"peerId,omitempty"`
+	Target     string             `json:"target,omitempty"`
+	SDP        string             `json:"sdp,omitempty"`
+	Candidate  json.RawMessage    `json:"candidate,omitempty"`
+	ICEServers []webrtc.ICEServer `json:"iceServers,omitempty"`
+}
+
+// defaultICEServers builds the fallback ICE server list used until (or
+// unless) the signaling server hands us one on join: the local -ice-config
+// file if set, otherwise the hardcoded STUN server plus -turn flags.
+func defaultICEServers() []webrtc.ICEServer {
+	if *iceConfigPath != "" {
+		cfg, err := iceconfig.Load(*iceConfigPath)
+		if err != nil {
+			log.Fatalf("iceconfig: %v", err)
+		}
+		servers, err := cfg.ICEServers(*room)
+		if err != nil {
+			log.Fatalf("iceconfig: %v", err)
+		}
+		return servers
+	}
+
+	servers := []webrtc.ICEServer{{URLs: []string{"stun:stun.l.google.com:19302"}}}
+	if *turnServerURL != "" {
+		servers = append(servers, webrtc.ICEServer{
+			URLs:       []string{*turnServerURL},
+			Username:   *turnUser,
+			Credential: *turnPass,
+		})
+		log.Printf("Added TURN: %s (user=%s)", *turnServerURL, *turnUser)
+	}
+	return servers
+}
+
 var (
-	wsMu            sync.Mutex
-	candidateBuffer []webrtc.ICECandidateInit
+	wsMu sync.Mutex
+
+	ownID string // assigned by the signaling server on "joined"
+
+	sessionsMu sync.Mutex
+	sessions   = make(map[string]*viewerSession) // keyed by viewer peer ID
 )
 
+// viewerSession is the PeerConnection and buffered ICE candidates for one
+// viewer that has joined the room.
+type viewerSession struct {
+	pc              *webrtc.PeerConnection
+	candidateBuffer []webrtc.ICECandidateInit
+}
+
 func safeWriteJSON(ws *websocket.Conn, v interface{}) error {
 	wsMu.Lock()
 	defer wsMu.Unlock()
-	log.Printf("SIGNAL → %T %+v", v, v)
+	log.Printf("SIGNAL → %+v", v)
 	return ws.WriteJSON(v)
 }
 
-func main() {
-	flag.Parse()
-
-	// 1) Connect to signaling server
-	log.Printf("🔌 Dialing signaling server at %s …", *signalURL)
-	ws, _, err := websocket.DefaultDialer.Dial(*signalURL, nil)
+// signalCandidate forwards a single gathered ICE candidate addressed to
+// target as its own signal/candidate message, or – once c is nil, meaning
+// gathering finished – an end-of-candidates sentinel with no candidate.
+func signalCandidate(ws *websocket.Conn, target string, c *webrtc.ICECandidate) {
+	if c == nil {
+		log.Printf("ICE gathering complete for %s – sending end-of-candidates", target)
+		safeWriteJSON(ws, Message{Type: "signal/candidate", PeerID: ownID, Target: target})
+		return
+	}
+	raw, err := json.Marshal(c.ToJSON())
 	if err != nil {
-		log.Fatalf("Could not connect to signaling server: %v", err)
+		log.Printf("Marshal candidate error: %v", err)
+		return
 	}
-	defer ws.Close()
-	log.Printf("Connected to signaling server at %s", *signalURL)
+	log.Printf("ICE candidate gathered for %s", target)
+	safeWriteJSON(ws, Message{Type: "signal/candidate", PeerID: ownID, Target: target, Candidate: raw})
+}
 
-	// 2) Build WebRTC config
-	config := webrtc.Configuration{
-		ICEServers: []webrtc.ICEServer{{URLs: []string{"stun:stun.l.google.com:19302"}}},
-	}
-	if *turnServerURL != "" {
-		config.ICEServers = append(config.ICEServers, webrtc.ICEServer{
-			URLs:       []string{*turnServerURL},
-			Username:   *turnUser,
-			Credential: *turnPass,
-		})
-		log.Printf("Added TURN: %s (user=%s)", *turnServerURL, *turnUser)
+// newCodecSelector builds the mediadevices codec selector for the configured
+// codec, set to the bitrate the operator asked for on the CLI. Capture size
+// and frame rate are applied separately, as GetDisplayMedia constraints.
+func newCodecSelector(codec string, bitRate int) (*mediadevices.CodecSelector, error) {
+	switch codec {
+	case "h264":
+		params, err := x264.NewParams()
+		if err != nil {
+			return nil, err
+		}
+		params.BitRate = bitRate
+		return mediadevices.NewCodecSelector(mediadevices.WithVideoEncoders(&params)), nil
+	case "vp8":
+		params, err := vpx.NewVP8Params()
+		if err != nil {
+			return nil, err
+		}
+		params.BitRate = bitRate
+		return mediadevices.NewCodecSelector(mediadevices.WithVideoEncoders(&params)), nil
+	default:
+		log.Fatalf("unknown -codec %q (want vp8 or h264)", codec)
+		return nil, nil
 	}
+}
 
-	// 3) Create PeerConnection
-	peerConn, err := webrtc.NewPeerConnection(config)
+// startSession creates a fresh PeerConnection for a newly joined viewer,
+// attaches the capture tracks to it and sends the viewer our offer.
+func startSession(ws *websocket.Conn, api *webrtc.API, config webrtc.Configuration, tracks []mediadevices.Track, viewerID string) {
+	log.Printf("Starting session for viewer %s", viewerID)
+	pc, err := api.NewPeerConnection(config)
 	if err != nil {
-		log.Fatalf("Error creating PeerConnection: %v", err)
+		log.Printf("NewPeerConnection for %s error: %v", viewerID, err)
+		return
 	}
-	log.Println("WebRTC PeerConnection created")
 
-	// 4) Outbound ICE candidates
-	peerConn.OnICECandidate(func(c *webrtc.ICECandidate) {
-		if c == nil {
+	sess := &viewerSession{pc: pc}
+	sessionsMu.Lock()
+	sessions[viewerID] = sess
+	sessionsMu.Unlock()
+
+	pc.OnICECandidate(func(c *webrtc.ICECandidate) {
+		signalCandidate(ws, viewerID, c)
+	})
+
+	for _, track := range tracks {
+		if _, err := pc.AddTransceiverFromTrack(track, webrtc.RtpTransceiverInit{
+			Direction: webrtc.RTPTransceiverDirectionSendonly,
+		}); err != nil {
+			log.Printf("AddTransceiverFromTrack for %s error: %v", viewerID, err)
 			return
 		}
-		log.Println("ICE candidate gathered")
-		safeWriteJSON(ws, map[string]interface{}{
-			"type":      "ice-candidate",
-			"candidate": c.ToJSON(),
-		})
-	})
+	}
 
-	// 5) Handle incoming DataChannel (viewer side)
-	peerConn.OnDataChannel(func(dc *webrtc.DataChannel) {
-		log.Printf("DataChannel '%s' created by remote", dc.Label())
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		log.Printf("CreateOffer for %s error: %v", viewerID, err)
+		return
+	}
+	if err := pc.SetLocalDescription(offer); err != nil {
+		log.Printf("SetLocalDescription for %s error: %v", viewerID, err)
+		return
+	}
 
-		dc.OnOpen(func() {
-			log.Println("DataChannel open – starting frame loop")
-		})
-		dc.OnMessage(func(msg webrtc.DataChannelMessage) {
-			// The bridge is sending, so ignore incoming here.
-			log.Printf("Unexpected DataChannel message (len=%d)", len(msg.Data))
-		})
+	log.Printf("Sending SDP offer to %s", viewerID)
+	safeWriteJSON(ws, Message{Type: "offer", PeerID: ownID, Target: viewerID, SDP: pc.LocalDescription().SDP})
+}
 
-		// Start sending screenshots
-		go func() {
-			for {
-				log.Println(" Capturing frame")
-				cmd := exec.Command("fbgrab", "/tmp/frame.png")
-				if err := cmd.Run(); err != nil {
-					log.Printf("Capture error: %v", err)
-					time.Sleep(time.Second)
-					continue
-				}
+func endSession(viewerID string) {
+	sessionsMu.Lock()
+	sess, ok := sessions[viewerID]
+	delete(sessions, viewerID)
+	sessionsMu.Unlock()
+	if ok {
+		sess.pc.Close()
+		log.Printf("Closed session for viewer %s", viewerID)
+	}
+}
 
-				data, err := os.ReadFile("/tmp/frame.png")
-				if err != nil {
-					log.Printf("Read error: %v", err)
-					time.Sleep(time.Second)
-					continue
-				}
-				log.Printf("Frame read: %d bytes", len(data))
+func main() {
+	flag.Parse()
 
-				if err := dc.Send(data); err != nil {
-					log.Printf("Send error: %v", err)
-					return
-				}
-				log.Printf("Frame sent: %d bytes", len(data))
+	// 1) Connect to signaling server and join our room as the publisher.
+	log.Printf("🔌 Dialing signaling server at %s …", *signalURL)
+	ws, _, err := websocket.DefaultDialer.Dial(*signalURL, nil)
+	if err != nil {
+		log.Fatalf("Could not connect to signaling server: %v", err)
+	}
+	defer ws.Close()
+	log.Printf("Connected to signaling server at %s", *signalURL)
 
-				time.Sleep(time.Second) // ~1 FPS
-			}
-		}()
+	safeWriteJSON(ws, Message{Type: "join", Room: *room, Role: "publisher"})
+
+	// 2) Build WebRTC config. This is provisional – if the signaling server
+	// hands us its own ICE server list on "joined", that replaces it below.
+	config := webrtc.Configuration{ICEServers: defaultICEServers()}
+
+	// 3) Register the codec(s) we intend to send with; every per-viewer
+	// PeerConnection is created through this same MediaEngine.
+	codecSelector, err := newCodecSelector(*codecName, *bitRate)
+	if err != nil {
+		log.Fatalf("Error building codec selector: %v", err)
+	}
+	mediaEngine := webrtc.MediaEngine{}
+	codecSelector.Populate(&mediaEngine)
+	api := webrtc.NewAPI(webrtc.WithMediaEngine(&mediaEngine))
+
+	// 4) Open the screen capture device once; its tracks are attached to
+	// every viewer's PeerConnection as they join.
+	mediaStream, err := mediadevices.GetDisplayMedia(mediadevices.MediaStreamConstraints{
+		Video: func(c *mediadevices.MediaTrackConstraints) {
+			c.Width = prop.Int(*width)
+			c.Height = prop.Int(*height)
+			c.FrameRate = prop.Float(*frameRate)
+		},
+		Codec: codecSelector,
 	})
+	if err != nil {
+		log.Fatalf("Error opening screen capture: %v", err)
+	}
+	tracks := mediaStream.GetTracks()
+	for _, track := range tracks {
+		track.OnEnded(func(err error) {
+			log.Printf("Video track ended: %v", err)
+		})
+		log.Printf("Capturing %s track (codec=%s, %dx%d@%.0f, bitrate=%d)",
+			track.Kind(), *codecName, *width, *height, *frameRate, *bitRate)
+	}
 
-	// 6) Signaling loop (receive Offer, send Answer, handle ICE)
+	// 5) Signaling loop
 	for {
-		var msg map[string]interface{}
+		var msg Message
 		if err := ws.ReadJSON(&msg); err != nil {
 			log.Printf("Signaling read error: %v", err)
 			return
 		}
-		log.Printf("🔔 SIGNAL ← %v", msg["type"])
+		log.Printf("🔔 SIGNAL ← %s", msg.Type)
 
-		switch msg["type"] {
-		case "offer":
-			// Apply remote SDP offer
-			offer := webrtc.SessionDescription{
-				Type: webrtc.SDPTypeOffer,
-				SDP:  msg["sdp"].(string),
+		switch msg.Type {
+		case "joined":
+			ownID = msg.PeerID
+			if len(msg.ICEServers) > 0 {
+				config.ICEServers = msg.ICEServers
+				log.Printf("Using %d ICE server(s) from signaling server", len(msg.ICEServers))
 			}
-			log.Println("Applying remote SDP offer")
-			if err := peerConn.SetRemoteDescription(offer); err != nil {
-				log.Fatalf("SetRemoteDescription error: %v", err)
+			log.Printf("Joined room %q as %s", msg.Room, ownID)
+
+		case "peer-joined":
+			if msg.Role == "viewer" {
+				go startSession(ws, api, config, tracks, msg.PeerID)
 			}
 
-			// Flush buffered ICE
-			for _, c := range candidateBuffer {
-				if err := peerConn.AddICECandidate(c); err != nil {
-					log.Printf("Buffer flush error: %v", err)
+		case "peer-left":
+			endSession(msg.PeerID)
+
+		case "answer":
+			sessionsMu.Lock()
+			sess, ok := sessions[msg.PeerID]
+			sessionsMu.Unlock()
+			if !ok {
+				log.Printf("Answer from unknown viewer %s", msg.PeerID)
+				continue
+			}
+			log.Printf("Applying remote SDP answer from %s", msg.PeerID)
+			if err := sess.pc.SetRemoteDescription(webrtc.SessionDescription{
+				Type: webrtc.SDPTypeAnswer,
+				SDP:  msg.SDP,
+			}); err != nil {
+				log.Printf("SetRemoteDescription error for %s: %v", msg.PeerID, err)
+				continue
+			}
+
+			sessionsMu.Lock()
+			buffered := sess.candidateBuffer
+			sess.candidateBuffer = nil
+			sessionsMu.Unlock()
+			for _, c := range buffered {
+				if err := sess.pc.AddICECandidate(c); err != nil {
+					log.Printf("Buffer flush error for %s: %v", msg.PeerID, err)
 				} else {
-					log.Println("Buffered ICE flushed")
+					log.Printf("Buffered ICE flushed for %s", msg.PeerID)
 				}
 			}
-			candidateBuffer = nil
 
-			// Create and send answer
-			log.Println("Creating SDP answer")
-			answer, err := peerConn.CreateAnswer(nil)
-			if err != nil {
-				log.Fatalf("CreateAnswer error: %v", err)
+		case "signal/candidate":
+			sessionsMu.Lock()
+			sess, ok := sessions[msg.PeerID]
+			sessionsMu.Unlock()
+			if !ok {
+				log.Printf("Candidate from unknown viewer %s", msg.PeerID)
+				continue
 			}
-			if err := peerConn.SetLocalDescription(answer); err != nil {
-				log.Fatalf("SetLocalDescription error: %v", err)
+
+			if len(msg.Candidate) == 0 || string(msg.Candidate) == "null" {
+				log.Printf("End-of-candidates from %s", msg.PeerID)
+				continue
 			}
-			go func() {
-				<-webrtc.GatheringCompletePromise(peerConn)
-				log.Println("Sending SDP answer")
-				safeWriteJSON(ws, map[string]interface{}{
-					"type": "answer",
-					"sdp":  peerConn.LocalDescription().SDP,
-				})
-			}()
-
-		case "ice-candidate":
-			// Incoming ICE
-			cand := msg["candidate"].(map[string]interface{})
-			sdpMid := cand["sdpMid"].(string)
-			sdpMLineIndex := uint16(cand["sdpMLineIndex"].(float64))
-			ci := webrtc.ICECandidateInit{
-				Candidate:     cand["candidate"].(string),
-				SDPMid:        &sdpMid,
-				SDPMLineIndex: &sdpMLineIndex,
+			var ci webrtc.ICECandidateInit
+			if err := json.Unmarshal(msg.Candidate, &ci); err != nil {
+				log.Printf("Unmarshal candidate error: %v", err)
+				continue
 			}
-			if peerConn.RemoteDescription() == nil {
-				log.Println("🗄️  Buffering ICE candidate")
-				candidateBuffer = append(candidateBuffer, ci)
-			} else {
-				log.Println("Adding ICE candidate")
-				if err := peerConn.AddICECandidate(ci); err != nil {
-					log.Printf("AddICECandidate error: %v", err)
+
+			sessionsMu.Lock()
+			hasRemote := sess.pc.RemoteDescription() != nil
+			if !hasRemote {
+				sess.candidateBuffer = append(sess.candidateBuffer, ci)
+			}
+			sessionsMu.Unlock()
+
+			if hasRemote {
+				log.Printf("Adding ICE candidate from %s", msg.PeerID)
+				if err := sess.pc.AddICECandidate(ci); err != nil {
+					log.Printf("AddICECandidate error for %s: %v", msg.PeerID, err)
 				}
+			} else {
+				log.Printf("🗄️  Buffering ICE candidate from %s", msg.PeerID)
 			}
 
-		case "answer":
-			log.Println("Unexpected 'answer' from viewer")
+		case "offer":
+			log.Println("Unexpected 'offer' from viewer")
 
 		default:
-			log.Printf("Unknown signal type: %v", msg["type"])
+			log.Printf("Unknown signal type: %v", msg.Type)
 		}
 	}
 }
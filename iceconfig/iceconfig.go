@@ -0,0 +1,113 @@
+// Package iceconfig loads the ICE server list the bridge, viewer and
+// signaling server all advertise, so the fleet can be repointed at new
+// STUN/TURN infrastructure by editing one JSON file instead of flags baked
+// into every binary.
+package iceconfig
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// ServerConfig describes one configured ICE server, Galene-style. When
+// TURNSecret is set the server is a TURN REST endpoint (RFC 7635): Username
+// and Credential are ignored and a fresh short-lived pair is derived per
+// session instead.
+type ServerConfig struct {
+	URLs       []string `json:"urls"`
+	Username   string   `json:"username,omitempty"`
+	Credential string   `json:"credential,omitempty"`
+
+	TURNSecret string `json:"turnSecret,omitempty"`
+	TURNTTL    string `json:"turnTtl,omitempty"` // parsed with time.ParseDuration; defaults to 1h
+}
+
+// Config is the top-level shape of the ICE server JSON file.
+type Config struct {
+	Servers []ServerConfig `json:"iceServers"`
+}
+
+var (
+	once    sync.Once
+	cached  *Config
+	loadErr error
+)
+
+// Load reads and decodes the ICE server JSON file at path exactly once per
+// process – the bridge and viewer each call this with the same -ice-config
+// flag at startup, and every call after the first just returns the cached
+// result.
+func Load(path string) (*Config, error) {
+	once.Do(func() {
+		cached, loadErr = loadFile(path)
+	})
+	return cached, loadErr
+}
+
+func loadFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("iceconfig: reading %s: %w", path, err)
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("iceconfig: parsing %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// ICEServers resolves every configured server into a webrtc.ICEServer,
+// deriving fresh TURN REST credentials for sessionUser wherever a server
+// has TURNSecret set.
+func (c *Config) ICEServers(sessionUser string) ([]webrtc.ICEServer, error) {
+	out := make([]webrtc.ICEServer, 0, len(c.Servers))
+	for _, s := range c.Servers {
+		resolved, err := s.resolve(sessionUser)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, resolved)
+	}
+	return out, nil
+}
+
+func (s ServerConfig) resolve(sessionUser string) (webrtc.ICEServer, error) {
+	if s.TURNSecret == "" {
+		return webrtc.ICEServer{URLs: s.URLs, Username: s.Username, Credential: s.Credential}, nil
+	}
+
+	ttl := time.Hour
+	if s.TURNTTL != "" {
+		parsed, err := time.ParseDuration(s.TURNTTL)
+		if err != nil {
+			return webrtc.ICEServer{}, fmt.Errorf("iceconfig: invalid turnTtl %q: %w", s.TURNTTL, err)
+		}
+		ttl = parsed
+	}
+
+	username, credential := turnRESTCredentials(s.TURNSecret, sessionUser, ttl)
+	return webrtc.ICEServer{URLs: s.URLs, Username: username, Credential: credential}, nil
+}
+
+// turnRESTCredentials implements the short-lived TURN REST credential
+// scheme (?service=turn&username=<user>): the username is
+// "<expiry-unix-seconds>:<user>" and the credential is the base64-encoded
+// HMAC-SHA1 of that username, keyed by the secret shared with the TURN
+// server.
+func turnRESTCredentials(secret, user string, ttl time.Duration) (username, credential string) {
+	expiry := time.Now().Add(ttl).Unix()
+	username = fmt.Sprintf("%d:%s", expiry, user)
+
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(username))
+	credential = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return username, credential
+}
@@ -11,17 +11,87 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"sync"
 	"time"
 )
 
 const (
-	port    = "8080" // TCP port to listen on
-	fps     = 1      // Frames per second
-	imgW    = 640    // Width of dummy image
-	imgH    = 480    // Height of dummy image
-	quality = 80     // JPEG quality (0–100)
+	port = "8080" // TCP port to listen on
+	imgW = 640    // Width of dummy image
+	imgH = 480    // Height of dummy image
+
+	captureFPS = 30 // internal capture rate; each client throttles down from here
+
+	initialQuality = 80 // JPEG quality (0-100) a fresh client starts at
+	minQuality     = 20
+	maxQuality     = 95
+
+	slowWriteThreshold = 200 * time.Millisecond // a write slower than this means the client can't keep up
 )
 
+// codecJPEG is the only codec id in use today; the frame header carries it
+// so future VP8/H.264 keyframes can be muxed onto the same wire format.
+const codecJPEG byte = 0
+
+const controlKeyframeRequest byte = 0x01
+
+// Frame is one captured, not-yet-encoded image plus the metadata every
+// client needs to build its own frame header.
+type Frame struct {
+	Sequence    uint64
+	TimestampNs int64
+	Image       *image.RGBA
+}
+
+// broadcaster fans a Frame out to every subscribed client. Each subscriber
+// gets its own small buffered channel; if a slow client hasn't drained it,
+// the oldest queued frame is dropped in favor of the newest one instead of
+// blocking the capture loop.
+type broadcaster struct {
+	mu   sync.Mutex
+	subs map[chan *Frame]struct{}
+}
+
+func newBroadcaster() *broadcaster {
+	return &broadcaster{subs: make(map[chan *Frame]struct{})}
+}
+
+func (b *broadcaster) subscribe() chan *Frame {
+	ch := make(chan *Frame, 2)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch
+}
+
+func (b *broadcaster) unsubscribe(ch chan *Frame) {
+	b.mu.Lock()
+	delete(b.subs, ch)
+	b.mu.Unlock()
+	close(ch)
+}
+
+func (b *broadcaster) publish(f *Frame) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- f:
+		default:
+			// Drop the oldest queued frame and retry so slow clients never
+			// stall the capture loop or build up unbounded RAM.
+			select {
+			case <-ch:
+			default:
+			}
+			select {
+			case ch <- f:
+			default:
+			}
+		}
+	}
+}
+
 // getPublicIP queries a public service to discover the Pi's external IP.
 func getPublicIP() (string, error) {
 	resp, err := http.Get("https://api.ipify.org")
@@ -37,60 +107,157 @@ func getPublicIP() (string, error) {
 	return string(data), nil
 }
 
-// generateDummyFrame creates a JPEG-encoded solid-color image.
-// The color cycles based on the current second for visual feedback.
-func generateDummyFrame() ([]byte, error) {
-	// Make a new RGBA image
+// captureFrame renders a solid-color image whose color cycles based on the
+// current second, for visual feedback.
+func captureFrame() *image.RGBA {
 	img := image.NewRGBA(image.Rect(0, 0, imgW, imgH))
 
-	// Pick a color that changes every second
 	sec := time.Now().Second()
 	col := color.RGBA{uint8(sec * 4), uint8(255 - sec*4), 128, 255}
 
-	// Fill the entire image with that color
 	for y := 0; y < imgH; y++ {
 		for x := 0; x < imgW; x++ {
 			img.Set(x, y, col)
 		}
 	}
+	return img
+}
 
-	// Encode to JPEG
-	var buf bytes.Buffer
-	err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
-	if err != nil {
-		return nil, fmt.Errorf("jpeg encode error: %w", err)
+// captureLoop is the single producer: it renders a frame at captureFPS and
+// publishes it to every subscribed client.
+func captureLoop(frames *broadcaster) {
+	ticker := time.NewTicker(time.Second / captureFPS)
+	defer ticker.Stop()
+
+	var sequence uint64
+	for range ticker.C {
+		sequence++
+		frames.publish(&Frame{
+			Sequence:    sequence,
+			TimestampNs: time.Now().UnixNano(),
+			Image:       captureFrame(),
+		})
 	}
-	return buf.Bytes(), nil
 }
 
-// handleConnection streams dummy frames to a connected client.
-// Each frame is prefixed with a 4-byte big-endian length header.
-func handleConnection(conn net.Conn) {
+// writeFrameHeader writes the fixed-size frame header – sequence,
+// timestampNs, width, height, codec, payload length – ahead of the encoded
+// payload.
+func writeFrameHeader(w io.Writer, f *Frame, payloadLen int) error {
+	for _, field := range []interface{}{
+		f.Sequence,
+		f.TimestampNs,
+		uint32(imgW),
+		uint32(imgH),
+		codecJPEG,
+		uint32(payloadLen),
+	} {
+		if err := binary.Write(w, binary.BigEndian, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readControlMessages watches for single-byte upstream control messages
+// (today, just a keyframe request) for the lifetime of the connection.
+func readControlMessages(conn net.Conn, keyframeReq chan<- struct{}) {
+	buf := make([]byte, 1)
+	for {
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return
+		}
+		if buf[0] == controlKeyframeRequest {
+			select {
+			case keyframeReq <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// adapt adjusts a client's JPEG quality and frame interval based on how long
+// its last write took: halve quality/double the interval on a slow write,
+// ramp both back up on a fast one.
+func adapt(clientAddr string, quality int, interval time.Duration, latency time.Duration) (int, time.Duration) {
+	if latency > slowWriteThreshold {
+		quality /= 2
+		if quality < minQuality {
+			quality = minQuality
+		}
+		interval *= 2
+		if interval > time.Second {
+			interval = time.Second
+		}
+		log.Printf("%s: slow write (%v) – backing off to quality=%d interval=%v\n", clientAddr, latency, quality, interval)
+		return quality, interval
+	}
+
+	if quality < maxQuality {
+		quality += 5
+		if quality > maxQuality {
+			quality = maxQuality
+		}
+	}
+	if interval > time.Second/captureFPS {
+		interval /= 2
+		if interval < time.Second/captureFPS {
+			interval = time.Second / captureFPS
+		}
+	}
+	return quality, interval
+}
+
+// handleConnection streams frames to a connected client: its own goroutine
+// reads from the broadcaster, encodes JPEG at a quality/interval it adapts
+// to the measured write latency, and writes a length-prefixed frame header
+// ahead of each payload.
+func handleConnection(conn net.Conn, frames *broadcaster) {
 	defer conn.Close()
 	clientAddr := conn.RemoteAddr().String()
 	log.Printf("👥 Client connected: %s\n", clientAddr)
 
-	ticker := time.NewTicker(time.Second / time.Duration(fps))
-	defer ticker.Stop()
+	sub := frames.subscribe()
+	defer frames.unsubscribe(sub)
 
-	for range ticker.C {
-		frame, err := generateDummyFrame()
-		if err != nil {
-			log.Printf("Frame generation error: %v\n", err)
-			return
+	keyframeReq := make(chan struct{}, 1)
+	go readControlMessages(conn, keyframeReq)
+
+	quality := initialQuality
+	interval := time.Second / captureFPS
+	var lastSent time.Time
+
+	for frame := range sub {
+		select {
+		case <-keyframeReq:
+			quality = maxQuality
+			log.Printf("%s: keyframe requested, resetting quality to %d\n", clientAddr, quality)
+		default:
+		}
+
+		if !lastSent.IsZero() && time.Since(lastSent) < interval {
+			continue // throttled: drop this frame, the next tick will catch up
 		}
 
-		// Write length prefix
-		if err := binary.Write(conn, binary.BigEndian, uint32(len(frame))); err != nil {
-			log.Printf("Error writing length to %s: %v\n", clientAddr, err)
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, frame.Image, &jpeg.Options{Quality: quality}); err != nil {
+			log.Printf("Frame encode error for %s: %v\n", clientAddr, err)
 			return
 		}
 
-		// Write JPEG data
-		if _, err := conn.Write(frame); err != nil {
+		start := time.Now()
+		if err := writeFrameHeader(conn, frame, buf.Len()); err != nil {
+			log.Printf("Error writing header to %s: %v\n", clientAddr, err)
+			return
+		}
+		if _, err := conn.Write(buf.Bytes()); err != nil {
 			log.Printf("Error sending frame to %s: %v\n", clientAddr, err)
 			return
 		}
+		latency := time.Since(start)
+		lastSent = time.Now()
+
+		quality, interval = adapt(clientAddr, quality, interval, latency)
 	}
 
 	log.Printf("Client disconnected: %s\n", clientAddr)
@@ -112,13 +279,16 @@ func main() {
 	defer ln.Close()
 	log.Printf("Listening on port %s (WAN)\n", port)
 
-	// 3) Accept and handle clients
+	// 3) Start the single capture producer and accept clients
+	frames := newBroadcaster()
+	go captureLoop(frames)
+
 	for {
 		conn, err := ln.Accept()
 		if err != nil {
 			log.Printf("Accept error: %v\n", err)
 			continue
 		}
-		go handleConnection(conn)
+		go handleConnection(conn, frames)
 	}
 }
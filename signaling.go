@@ -1,19 +1,185 @@
+// signaling.go
+//
+// Room-aware signaling hub, loosely modeled on Galene/Neko: clients join a
+// named room as a "publisher" or "viewer", the hub assigns each a peer ID,
+// and offer/answer/candidate messages are routed to a specific targetPeer
+// instead of being broadcast to everyone connected.
+
 package main
 
 import (
+	"encoding/json"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"sync"
+	"sync/atomic"
 
+	"github.com/Eduardo-Sal/Screenshare-App/iceconfig"
 	"github.com/gorilla/websocket"
+	"github.com/pion/webrtc/v3"
 )
 
+var iceConfigPath = flag.String("ice-config", "", "path to a JSON file of ICE servers to hand clients on join")
+
+var upgrader = websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+
+// Message is the envelope every signaling participant speaks. Not every
+// field is set on every message type:
+//   - join:             Room, Role, PeerID (optional; server assigns if empty)
+//   - joined:           Room, PeerID (the ID the server assigned), ICEServers
+//   - peer-joined/left:  Room, PeerID, Role (describes the peer that changed)
+//   - offer/answer:      PeerID (sender), Target (recipient), SDP
+//   - signal/candidate:  PeerID (sender), Target (recipient), Candidate (nil = end-of-candidates)
+type Message struct {
+	Type       string             `json:"type"`
+	Room       string             `json:"room,omitempty"`
+	Role       string             `json:"role,omitempty"`
+	PeerID     string             `json:"peerId,omitempty"`
+	Target     string             `json:"target,omitempty"`
+	SDP        string             `json:"sdp,omitempty"`
+	Candidate  json.RawMessage    `json:"candidate,omitempty"`
+	ICEServers []webrtc.ICEServer `json:"iceServers,omitempty"`
+}
+
+// iceServersFor resolves the configured ICE server list (if -ice-config was
+// given) for sessionUser, so bridges and viewers don't need their own copy
+// and pick up rotated TURN credentials automatically on their next join.
+func iceServersFor(sessionUser string) []webrtc.ICEServer {
+	if *iceConfigPath == "" {
+		return nil
+	}
+	cfg, err := iceconfig.Load(*iceConfigPath)
+	if err != nil {
+		log.Printf("iceconfig: %v", err)
+		return nil
+	}
+	servers, err := cfg.ICEServers(sessionUser)
+	if err != nil {
+		log.Printf("iceconfig: %v", err)
+		return nil
+	}
+	return servers
+}
+
+// Peer is one connected publisher or viewer inside a Room.
+type Peer struct {
+	ID   string
+	Role string
+	Room string
+
+	mu sync.Mutex // guards writes to ws, which gorilla does not allow concurrently
+	ws *websocket.Conn
+}
+
+func (p *Peer) send(m Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.ws.WriteJSON(m)
+}
+
+// Room groups the peers sharing a stream: normally one publisher and any
+// number of viewers.
+type Room struct {
+	mu    sync.Mutex
+	peers map[string]*Peer
+}
+
+func (r *Room) add(p *Peer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.peers[p.ID] = p
+}
+
+func (r *Room) remove(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.peers, id)
+}
+
+func (r *Room) get(id string) (*Peer, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.peers[id]
+	return p, ok
+}
+
+func (r *Room) members() []*Peer {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]*Peer, 0, len(r.peers))
+	for _, p := range r.peers {
+		out = append(out, p)
+	}
+	return out
+}
+
+func (r *Room) broadcastExcept(self string, m Message) {
+	for _, p := range r.members() {
+		if p.ID == self {
+			continue
+		}
+		if err := p.send(m); err != nil {
+			log.Printf("broadcast %s to %s failed: %v", m.Type, p.ID, err)
+		}
+	}
+}
+
+// Hub owns every active Room, keyed by room name.
+type Hub struct {
+	mu    sync.Mutex
+	rooms map[string]*Room
+}
+
+func newHub() *Hub {
+	return &Hub{rooms: make(map[string]*Room)}
+}
+
+func (h *Hub) room(name string) *Room {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	r, ok := h.rooms[name]
+	if !ok {
+		r = &Room{peers: make(map[string]*Peer)}
+		h.rooms[name] = r
+	}
+	return r
+}
+
+func (h *Hub) dropIfEmpty(name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if r, ok := h.rooms[name]; ok && len(r.members()) == 0 {
+		delete(h.rooms, name)
+	}
+}
+
+// snapshot renders the hub for the /rooms endpoint as room -> ["peerID:role", ...].
+func (h *Hub) snapshot() map[string][]string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make(map[string][]string, len(h.rooms))
+	for name, r := range h.rooms {
+		members := r.members()
+		list := make([]string, 0, len(members))
+		for _, p := range members {
+			list = append(list, fmt.Sprintf("%s:%s", p.ID, p.Role))
+		}
+		out[name] = list
+	}
+	return out
+}
+
 var (
-	upgrader = websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
-	clients  = make(map[*websocket.Conn]bool)
-	mu       sync.Mutex
+	hub         = newHub()
+	nextPeerNum uint64
 )
 
+func generatePeerID() string {
+	return fmt.Sprintf("peer-%d", atomic.AddUint64(&nextPeerNum, 1))
+}
+
 func handleWS(w http.ResponseWriter, r *http.Request) {
 	ws, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -22,33 +188,83 @@ func handleWS(w http.ResponseWriter, r *http.Request) {
 	}
 	defer ws.Close()
 
-	mu.Lock()
-	clients[ws] = true
-	mu.Unlock()
-	log.Printf("Client connected: %s", ws.RemoteAddr())
+	var room *Room
+	var self *Peer
 
 	for {
-		mt, msg, err := ws.ReadMessage()
-		if err != nil {
+		var msg Message
+		if err := ws.ReadJSON(&msg); err != nil {
 			break
 		}
-		mu.Lock()
-		for c := range clients {
-			if c != ws {
-				c.WriteMessage(mt, msg)
+
+		switch msg.Type {
+		case "join":
+			if msg.PeerID == "" {
+				msg.PeerID = generatePeerID()
+			}
+			self = &Peer{ID: msg.PeerID, Role: msg.Role, Room: msg.Room, ws: ws}
+			room = hub.room(msg.Room)
+
+			// Tell the newcomer who it is (and its ICE servers) before telling
+			// it about anyone already in the room, so a client that reacts to
+			// peer-joined by starting a session always has its own ID and
+			// server-assigned ICE config in hand first.
+			self.send(Message{Type: "joined", Room: msg.Room, PeerID: self.ID, ICEServers: iceServersFor(self.ID)})
+
+			// Tell the newcomer about everyone already here, then tell
+			// everyone already here about the newcomer.
+			for _, p := range room.members() {
+				self.send(Message{Type: "peer-joined", Room: msg.Room, PeerID: p.ID, Role: p.Role})
+			}
+			room.add(self)
+			room.broadcastExcept(self.ID, Message{Type: "peer-joined", Room: msg.Room, PeerID: self.ID, Role: self.Role})
+
+			log.Printf("%s (%s) joined room %q", self.ID, self.Role, msg.Room)
+
+		case "offer", "answer", "signal/candidate":
+			if room == nil || self == nil {
+				log.Printf("Dropping %s before join", msg.Type)
+				continue
 			}
+			msg.PeerID = self.ID
+			target, ok := room.get(msg.Target)
+			if !ok {
+				log.Printf("Unknown targetPeer %q in room %q", msg.Target, msg.Room)
+				continue
+			}
+			if err := target.send(msg); err != nil {
+				log.Printf("Routing %s to %s failed: %v", msg.Type, target.ID, err)
+			}
+
+		default:
+			log.Printf("Unknown signal type: %q", msg.Type)
 		}
-		mu.Unlock()
 	}
 
-	mu.Lock()
-	delete(clients, ws)
-	mu.Unlock()
-	log.Printf("Client disconnected: %s", ws.RemoteAddr())
+	if self != nil && room != nil {
+		room.remove(self.ID)
+		room.broadcastExcept(self.ID, Message{Type: "peer-left", Room: self.Room, PeerID: self.ID, Role: self.Role})
+		hub.dropIfEmpty(self.Room)
+		log.Printf("%s (%s) left room %q", self.ID, self.Role, self.Room)
+	}
+}
+
+// handleRooms lists every active room and its members, e.g.
+// {"default": ["peer-1:publisher", "peer-2:viewer"]}.
+func handleRooms(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(hub.snapshot()); err != nil {
+		log.Printf("Encoding /rooms response failed: %v", err)
+	}
 }
 
 func main() {
+	flag.Parse()
+
 	http.HandleFunc("/ws", handleWS)
-	log.Println("Signaling server listening on :8000/ws")
+	http.HandleFunc("/rooms", handleRooms)
+	http.HandleFunc("/whip/", handleWHIP)
+	http.HandleFunc("/whep/", handleWHEP)
+	log.Println("Signaling server listening on :8000 (/ws signaling, /rooms status, /whip and /whep ingest+egress)")
 	log.Fatal(http.ListenAndServe(":8000", nil))
 }
@@ -0,0 +1,381 @@
+// viewer/main.go
+//
+// Fyne-based viewer: joins a room on the signaling server, waits for the
+// publisher to offer a PeerConnection, and renders its incoming video track.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/app"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+	"github.com/Eduardo-Sal/Screenshare-App/iceconfig"
+	"github.com/gorilla/websocket"
+	"github.com/pion/mediadevices/pkg/codec/vpx"
+	"github.com/pion/mediadevices/pkg/frame"
+	"github.com/pion/mediadevices/pkg/prop"
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media/samplebuilder"
+)
+
+var (
+	room          = flag.String("room", "default", "signaling room to join as a viewer")
+	iceConfigPath = flag.String("ice-config", "", "path to a JSON file of ICE servers (overridden by what the signaling server hands us on join)")
+)
+
+// Message mirrors the signaling server's envelope (see signaling.go).
+type Message struct {
+	Type       string             `json:"type"`
+	Room       string             `json:"room,omitempty"`
+	Role       string             `json:"role,omitempty"`
+	PeerID     string             `json:"peerId,omitempty"`
+	Target     string             `json:"target,omitempty"`
+	SDP        string             `json:"sdp,omitempty"`
+	Candidate  json.RawMessage    `json:"candidate,omitempty"`
+	ICEServers []webrtc.ICEServer `json:"iceServers,omitempty"`
+}
+
+var (
+	wsMu sync.Mutex
+
+	ownID      string             // assigned by the signaling server on "joined"
+	iceServers []webrtc.ICEServer // resolved once on "joined"; see defaultICEServers
+
+	sessionsMu sync.Mutex
+	sessions   = make(map[string]*publisherSession) // keyed by publisher peer ID
+)
+
+// defaultICEServers builds the fallback ICE server list used unless the
+// signaling server hands us one on join: the local -ice-config file if set,
+// otherwise the hardcoded STUN server plus a TURN server on ip, the
+// signaling server's address.
+func defaultICEServers(ip string) []webrtc.ICEServer {
+	if *iceConfigPath != "" {
+		cfg, err := iceconfig.Load(*iceConfigPath)
+		if err != nil {
+			log.Fatalf("iceconfig: %v", err)
+		}
+		servers, err := cfg.ICEServers(*room)
+		if err != nil {
+			log.Fatalf("iceconfig: %v", err)
+		}
+		return servers
+	}
+
+	return []webrtc.ICEServer{
+		{URLs: []string{"stun:stun.l.google.com:19302"}},
+		{URLs: []string{fmt.Sprintf("turn:%s:3478", ip)}, Username: "user", Credential: "pass"},
+	}
+}
+
+// publisherSession is the PeerConnection and buffered ICE candidates for
+// one publisher that has offered us its stream.
+type publisherSession struct {
+	pc              *webrtc.PeerConnection
+	candidateBuffer []webrtc.ICECandidateInit
+}
+
+func safeWriteJSON(ws *websocket.Conn, v interface{}) error {
+	wsMu.Lock()
+	defer wsMu.Unlock()
+	return ws.WriteJSON(v)
+}
+
+// signalCandidate forwards a single gathered ICE candidate addressed to
+// target as its own signal/candidate message, or – once c is nil, meaning
+// gathering finished – an end-of-candidates sentinel with no candidate.
+func signalCandidate(ws *websocket.Conn, target string, c *webrtc.ICECandidate) {
+	if c == nil {
+		log.Printf("ICE gathering complete for %s – sending end-of-candidates", target)
+		safeWriteJSON(ws, Message{Type: "signal/candidate", PeerID: ownID, Target: target})
+		return
+	}
+	raw, err := json.Marshal(c.ToJSON())
+	if err != nil {
+		log.Printf("Marshal candidate error: %v", err)
+		return
+	}
+	log.Printf("ICE candidate gathered for %s", target)
+	safeWriteJSON(ws, Message{Type: "signal/candidate", PeerID: ownID, Target: target, Candidate: raw})
+}
+
+func main() {
+	flag.Parse()
+	piIP := "4.227.177.31" // Replace with your signaling server IP
+
+	a := app.New()
+	w := a.NewWindow("Screenshare Viewer")
+	status := widget.NewLabel("Connecting…")
+	img := canvas.NewImageFromResource(nil)
+	img.FillMode = canvas.ImageFillContain
+
+	w.SetContent(container.NewVBox(img, status))
+	w.Resize(fyne.NewSize(640, 480))
+	w.Show()
+
+	go func() {
+		err := connectAndStream(piIP, func(frame image.Image) {
+			img.Image = frame
+			img.Refresh()
+		}, func(s string) {
+			log.Println("📺 Status:", s)
+			status.SetText(s)
+		})
+		if err != nil {
+			log.Println(" Fatal error:", err)
+			status.SetText("Error: " + err.Error())
+			os.Exit(1)
+		}
+	}()
+
+	a.Run()
+}
+
+// renderTrack picks the depacketizer/decoder for the codec the publisher
+// actually negotiated (the bridge's -codec flag decides that, see
+// client-bridge.go's newCodecSelector) rather than assuming VP8, since a
+// viewer fed H.264 RTP through a VP8 decoder just spams decode errors.
+func renderTrack(track *webrtc.TrackRemote, onFrame func(image.Image)) {
+	switch strings.ToLower(track.Codec().MimeType) {
+	case strings.ToLower(webrtc.MimeTypeVP8):
+		renderVP8(track, onFrame)
+	default:
+		// mediadevices only ships a VP8 decoder today; there's no H.264
+		// decode path to fall back to, so log clearly instead of silently
+		// dropping frames through the wrong decoder.
+		log.Printf("renderTrack: no decoder for codec %s, dropping track", track.Codec().MimeType)
+	}
+}
+
+// renderVP8 reads RTP packets off a remote VP8 track, reassembles them into
+// complete frames with a sample builder, and decodes each frame into an
+// image.Image for the caller to draw. mediadevices' VP8 decoder reads its
+// encoded bitstream from an io.Reader, so samples are piped into it as they
+// arrive off the wire.
+func renderVP8(track *webrtc.TrackRemote, onFrame func(image.Image)) {
+	pr, pw := io.Pipe()
+	decoder, err := vpx.BuildVideoDecoder(pr, prop.Media{
+		Video: prop.Video{
+			// Only a sizing hint for the decoder's initial config; the
+			// actual per-frame dimensions come from the VP8 bitstream.
+			Width:       1280,
+			Height:      720,
+			FrameFormat: frame.FormatI420,
+		},
+	})
+	if err != nil {
+		log.Println("VP8 decoder init error:", err)
+		return
+	}
+	defer decoder.Close()
+
+	go func() {
+		defer pw.Close()
+		builder := samplebuilder.New(50, &codecs.VP8Packet{}, track.Codec().ClockRate)
+		for {
+			pkt, _, err := track.ReadRTP()
+			if err != nil {
+				log.Println("ReadRTP error:", err)
+				return
+			}
+			builder.Push(pkt)
+
+			for sample := builder.Pop(); sample != nil; sample = builder.Pop() {
+				if _, err := pw.Write(sample.Data); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		img, release, err := decoder.Read()
+		if err != nil {
+			log.Println("VP8 decode error:", err)
+			return
+		}
+		onFrame(img)
+		release()
+	}
+}
+
+// acceptOffer creates a PeerConnection for a newly-offering publisher,
+// applies its SDP offer, and answers it.
+func acceptOffer(ws *websocket.Conn, publisherID, sdp string, onFrame func(image.Image), onStatus func(string)) {
+	log.Printf("Accepting offer from publisher %s", publisherID)
+
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{ICEServers: iceServers})
+	if err != nil {
+		log.Printf("PeerConnection error for %s: %v", publisherID, err)
+		return
+	}
+
+	// The "offer" case already registered a placeholder session for
+	// publisherID before spawning us; fill in its PeerConnection rather than
+	// replacing it, so candidates buffered against the placeholder aren't
+	// orphaned.
+	sessionsMu.Lock()
+	sess := sessions[publisherID]
+	sess.pc = pc
+	sessionsMu.Unlock()
+
+	pc.OnTrack(func(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
+		log.Printf("🎥 Track received from %s: kind=%s codec=%s", publisherID, track.Kind(), track.Codec().MimeType)
+		onStatus("Streaming…")
+		go renderTrack(track, onFrame)
+	})
+
+	pc.OnICECandidate(func(c *webrtc.ICECandidate) {
+		signalCandidate(ws, publisherID, c)
+	})
+
+	if err := pc.SetRemoteDescription(webrtc.SessionDescription{
+		Type: webrtc.SDPTypeOffer,
+		SDP:  sdp,
+	}); err != nil {
+		log.Printf("SetRemoteDescription error for %s: %v", publisherID, err)
+		return
+	}
+
+	sessionsMu.Lock()
+	buffered := sess.candidateBuffer
+	sess.candidateBuffer = nil
+	sessionsMu.Unlock()
+	for _, c := range buffered {
+		if err := pc.AddICECandidate(c); err != nil {
+			log.Printf("Buffer flush error for %s: %v", publisherID, err)
+		} else {
+			log.Printf("Buffered ICE flushed for %s", publisherID)
+		}
+	}
+
+	answer, err := pc.CreateAnswer(nil)
+	if err != nil {
+		log.Printf("CreateAnswer error for %s: %v", publisherID, err)
+		return
+	}
+	if err := pc.SetLocalDescription(answer); err != nil {
+		log.Printf("SetLocalDescription error for %s: %v", publisherID, err)
+		return
+	}
+
+	log.Printf("Sending SDP answer to %s", publisherID)
+	safeWriteJSON(ws, Message{Type: "answer", PeerID: ownID, Target: publisherID, SDP: pc.LocalDescription().SDP})
+}
+
+func connectAndStream(ip string, onFrame func(image.Image), onStatus func(string)) error {
+	u := url.URL{Scheme: "ws", Host: ip + ":8000", Path: "/ws"}
+	log.Println("🔌 Connecting to WebSocket at", u.String())
+
+	ws, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("WebSocket error: %w", err)
+	}
+	defer ws.Close()
+	onStatus("WebSocket connected")
+
+	safeWriteJSON(ws, Message{Type: "join", Room: *room, Role: "viewer"})
+
+	for {
+		var msg Message
+		if err := ws.ReadJSON(&msg); err != nil {
+			return err
+		}
+		log.Printf("🔔 Received message: %v", msg.Type)
+
+		switch msg.Type {
+		case "joined":
+			ownID = msg.PeerID
+			if len(msg.ICEServers) > 0 {
+				iceServers = msg.ICEServers
+				log.Printf("Using %d ICE server(s) from signaling server", len(msg.ICEServers))
+			} else {
+				iceServers = defaultICEServers(ip)
+			}
+			log.Printf("Joined room %q as %s", msg.Room, ownID)
+
+		case "peer-joined":
+			// The publisher drives negotiation; we just wait for its offer.
+			log.Printf("Peer %s (%s) joined the room", msg.PeerID, msg.Role)
+
+		case "peer-left":
+			sessionsMu.Lock()
+			sess, ok := sessions[msg.PeerID]
+			delete(sessions, msg.PeerID)
+			sessionsMu.Unlock()
+			if ok && sess.pc != nil {
+				sess.pc.Close()
+				onStatus("Publisher disconnected")
+				log.Printf("Closed session for publisher %s", msg.PeerID)
+			}
+
+		case "offer":
+			// Register the session synchronously, before handing off to the
+			// acceptOffer goroutine, so a signal/candidate trickled in right
+			// behind this offer (processed inline by this same read loop)
+			// always finds a session to buffer against instead of being
+			// dropped as "unknown publisher".
+			sessionsMu.Lock()
+			sessions[msg.PeerID] = &publisherSession{}
+			sessionsMu.Unlock()
+			go acceptOffer(ws, msg.PeerID, msg.SDP, onFrame, onStatus)
+
+		case "signal/candidate":
+			sessionsMu.Lock()
+			sess, ok := sessions[msg.PeerID]
+			sessionsMu.Unlock()
+			if !ok {
+				log.Printf("Candidate from unknown publisher %s", msg.PeerID)
+				continue
+			}
+
+			if len(msg.Candidate) == 0 || string(msg.Candidate) == "null" {
+				log.Printf("End-of-candidates from %s", msg.PeerID)
+				continue
+			}
+			var ci webrtc.ICECandidateInit
+			if err := json.Unmarshal(msg.Candidate, &ci); err != nil {
+				log.Printf("Unmarshal candidate error: %v", err)
+				continue
+			}
+
+			sessionsMu.Lock()
+			// sess.pc is nil until acceptOffer's PeerConnection is ready, so
+			// candidates arriving between the offer and that point are
+			// buffered here exactly like pre-SetRemoteDescription ones.
+			hasRemote := sess.pc != nil && sess.pc.RemoteDescription() != nil
+			if !hasRemote {
+				sess.candidateBuffer = append(sess.candidateBuffer, ci)
+			}
+			sessionsMu.Unlock()
+
+			if hasRemote {
+				log.Printf("Adding ICE candidate from %s", msg.PeerID)
+				if err := sess.pc.AddICECandidate(ci); err != nil {
+					log.Println("ICE candidate error:", err)
+				} else {
+					log.Println("ICE candidate added")
+				}
+			} else {
+				log.Printf("🗄️  Buffering ICE candidate from %s", msg.PeerID)
+			}
+
+		default:
+			log.Printf("Unknown signal type: %v", msg.Type)
+		}
+	}
+}
@@ -0,0 +1,433 @@
+// whip.go
+//
+// WHIP (WebRTC-HTTP Ingestion Protocol) and WHEP (WebRTC-HTTP Egress
+// Protocol) endpoints, so the Pi bridge can publish – and browsers/ffplay/OBS
+// can subscribe – without touching the WebSocket signaling in signaling.go.
+// Both protocols share the same resource model: POST an SDP offer, get back
+// an SDP answer plus a Location header for later PATCH/DELETE, and trickle
+// late ICE candidates in as application/trickle-ice-sdpfrag bodies.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// ingestStream holds the local tracks a WHIP publisher has forwarded for a
+// given stream name, ready to be handed to WHEP subscribers.
+type ingestStream struct {
+	mu     sync.Mutex
+	tracks []*webrtc.TrackLocalStaticRTP
+	ready  chan struct{} // closed while the stream has at least one live track
+}
+
+func newIngestStream() *ingestStream {
+	return &ingestStream{ready: make(chan struct{})}
+}
+
+func (s *ingestStream) addTrack(t *webrtc.TrackLocalStaticRTP) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tracks = append(s.tracks, t)
+	if len(s.tracks) == 1 {
+		close(s.ready)
+	}
+}
+
+// removeTrack drops t when its publisher disconnects. Once the stream is
+// left with no tracks, ready is replaced with a fresh, open channel so a
+// WHEP subscriber that arrives before the next publisher does goes back to
+// waiting instead of being handed the now-dead track.
+func (s *ingestStream) removeTrack(t *webrtc.TrackLocalStaticRTP) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, existing := range s.tracks {
+		if existing == t {
+			s.tracks = append(s.tracks[:i], s.tracks[i+1:]...)
+			break
+		}
+	}
+	if len(s.tracks) == 0 {
+		s.ready = make(chan struct{})
+	}
+}
+
+func (s *ingestStream) snapshot() []*webrtc.TrackLocalStaticRTP {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]*webrtc.TrackLocalStaticRTP, len(s.tracks))
+	copy(out, s.tracks)
+	return out
+}
+
+// readyChan returns the channel to wait on for the next track, snapshotted
+// under the lock since addTrack/removeTrack may swap it out from under a
+// stream with no current tracks.
+func (s *ingestStream) readyChan() chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ready
+}
+
+var (
+	streamsMu sync.Mutex
+	streams   = make(map[string]*ingestStream) // keyed by stream name
+)
+
+func streamFor(name string) *ingestStream {
+	streamsMu.Lock()
+	defer streamsMu.Unlock()
+	s, ok := streams[name]
+	if !ok {
+		s = newIngestStream()
+		streams[name] = s
+	}
+	return s
+}
+
+// whipResource is a PeerConnection created by either a WHIP publish or a
+// WHEP subscribe, addressable by its own URL for later PATCH/DELETE.
+type whipResource struct {
+	pc   *webrtc.PeerConnection
+	etag string
+}
+
+var (
+	resourcesMu     sync.Mutex
+	resources       = make(map[string]*whipResource)
+	nextResourceNum uint64
+)
+
+func newResource(pc *webrtc.PeerConnection) *whipResource {
+	id := fmt.Sprintf("res-%d", atomic.AddUint64(&nextResourceNum, 1))
+	res := &whipResource{pc: pc, etag: id}
+	resourcesMu.Lock()
+	resources[id] = res
+	resourcesMu.Unlock()
+	return res
+}
+
+func lookupResource(id string) (*whipResource, bool) {
+	resourcesMu.Lock()
+	defer resourcesMu.Unlock()
+	res, ok := resources[id]
+	return res, ok
+}
+
+func removeResource(id string) {
+	resourcesMu.Lock()
+	defer resourcesMu.Unlock()
+	delete(resources, id)
+}
+
+var whipICEServers = []webrtc.ICEServer{{URLs: []string{"stun:stun.l.google.com:19302"}}}
+
+// handleWHIP serves POST /whip/{stream} (publish) plus PATCH/DELETE
+// /whip/{stream}/{resourceID} for trickle ICE and teardown.
+func handleWHIP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/whip/"), "/"), "/")
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodPost:
+		whipPublish(w, r, parts[0])
+	case len(parts) == 2 && r.Method == http.MethodPatch:
+		patchCandidate(w, r, parts[1])
+	case len(parts) == 2 && r.Method == http.MethodDelete:
+		teardownResource(w, r, parts[1])
+	default:
+		http.Error(w, "unsupported WHIP request", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleWHEP serves POST /whep/{stream} (subscribe) plus PATCH/DELETE
+// /whep/{stream}/{resourceID}, mirroring handleWHIP.
+func handleWHEP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/whep/"), "/"), "/")
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodPost:
+		whepSubscribe(w, r, parts[0])
+	case len(parts) == 2 && r.Method == http.MethodPatch:
+		patchCandidate(w, r, parts[1])
+	case len(parts) == 2 && r.Method == http.MethodDelete:
+		teardownResource(w, r, parts[1])
+	default:
+		http.Error(w, "unsupported WHEP request", http.StatusMethodNotAllowed)
+	}
+}
+
+func readSDPOffer(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if ct := r.Header.Get("Content-Type"); ct != "application/sdp" {
+		http.Error(w, "expected Content-Type: application/sdp", http.StatusUnsupportedMediaType)
+		return "", false
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "failed to read SDP offer", http.StatusBadRequest)
+		return "", false
+	}
+	return string(body), true
+}
+
+func respondWithAnswer(w http.ResponseWriter, path string, pc *webrtc.PeerConnection) {
+	res := newResource(pc)
+	w.Header().Set("Content-Type", "application/sdp")
+	w.Header().Set("Location", fmt.Sprintf("%s/%s", path, res.etag))
+	w.Header().Set("ETag", res.etag)
+	w.WriteHeader(http.StatusCreated)
+	io.WriteString(w, pc.LocalDescription().SDP)
+}
+
+// whipPublish ingests a publisher's offer and relays every track it sends
+// onto an ingestStream so WHEP subscribers (or future room viewers) can pull
+// from it.
+func whipPublish(w http.ResponseWriter, r *http.Request, streamName string) {
+	offerSDP, ok := readSDPOffer(w, r)
+	if !ok {
+		return
+	}
+
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{ICEServers: whipICEServers})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	stream := streamFor(streamName)
+
+	var addedMu sync.Mutex
+	var added []*webrtc.TrackLocalStaticRTP
+
+	pc.OnTrack(func(remote *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		local, err := webrtc.NewTrackLocalStaticRTP(remote.Codec().RTPCodecCapability, remote.ID(), streamName)
+		if err != nil {
+			log.Printf("WHIP %s: local track error: %v", streamName, err)
+			return
+		}
+		stream.addTrack(local)
+		addedMu.Lock()
+		added = append(added, local)
+		addedMu.Unlock()
+		log.Printf("WHIP %s: forwarding %s track", streamName, remote.Kind())
+
+		buf := make([]byte, 1500)
+		for {
+			n, _, err := remote.Read(buf)
+			if err != nil {
+				return
+			}
+			if _, err := local.Write(buf[:n]); err != nil {
+				return
+			}
+		}
+	})
+
+	// On teardown (ICE failure, the Pi dropping off the network, or an
+	// explicit DELETE closing pc) drop this publisher's tracks from the
+	// stream so a WHEP subscriber never gets handed dead ones, and so
+	// whepSubscribe actually waits (up to whepWaitForTrack) for a live
+	// publisher to reconnect.
+	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		switch state {
+		case webrtc.PeerConnectionStateDisconnected, webrtc.PeerConnectionStateFailed, webrtc.PeerConnectionStateClosed:
+			addedMu.Lock()
+			gone := added
+			added = nil
+			addedMu.Unlock()
+			for _, t := range gone {
+				stream.removeTrack(t)
+			}
+			if len(gone) > 0 {
+				log.Printf("WHIP %s: publisher %s, dropped %d track(s)", streamName, state, len(gone))
+			}
+			if state != webrtc.PeerConnectionStateClosed {
+				pc.Close()
+			}
+		}
+	})
+
+	if err := pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: offerSDP}); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	answer, err := pc.CreateAnswer(nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := pc.SetLocalDescription(answer); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	<-webrtc.GatheringCompletePromise(pc)
+
+	log.Printf("WHIP %s: publisher connected", streamName)
+	respondWithAnswer(w, "/whip/"+streamName, pc)
+}
+
+// whepWaitForTrack bounds how long whepSubscribe will hold an SDP answer
+// open waiting for a WHIP publisher to show up, since WHEP subscribers are
+// expected to be able to attach independently of publish order.
+const whepWaitForTrack = 5 * time.Second
+
+// whepSubscribe hands a subscriber every track currently published for
+// streamName. If the stream has no tracks yet (the publisher hasn't
+// connected, or hasn't started sending media), this blocks up to
+// whepWaitForTrack for the first one to arrive rather than answering with no
+// media and leaving the subscriber stuck with a track-less PeerConnection it
+// can never recover.
+func whepSubscribe(w http.ResponseWriter, r *http.Request, streamName string) {
+	offerSDP, ok := readSDPOffer(w, r)
+	if !ok {
+		return
+	}
+
+	stream := streamFor(streamName)
+	tracks := stream.snapshot()
+	if len(tracks) == 0 {
+		select {
+		case <-stream.readyChan():
+			tracks = stream.snapshot()
+		case <-time.After(whepWaitForTrack):
+			http.Error(w, fmt.Sprintf("stream %q has no published tracks yet", streamName), http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{ICEServers: whipICEServers})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for _, track := range tracks {
+		if _, err := pc.AddTrack(track); err != nil {
+			log.Printf("WHEP %s: AddTrack error: %v", streamName, err)
+		}
+	}
+
+	if err := pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: offerSDP}); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	answer, err := pc.CreateAnswer(nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := pc.SetLocalDescription(answer); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	<-webrtc.GatheringCompletePromise(pc)
+
+	log.Printf("WHEP %s: subscriber connected (%d tracks)", streamName, len(tracks))
+	respondWithAnswer(w, "/whep/"+streamName, pc)
+}
+
+// parseTrickleFragment decodes an application/trickle-ice-sdpfrag body
+// (RFC 8840) into the ICE candidates it carries, in order, plus whether it
+// ends the session with an "a=end-of-candidates" line. Real fragments from
+// OBS/GStreamer's whipsink are multi-line SDP, not a bare candidate string:
+//
+//	a=ice-ufrag:EsAw
+//	a=ice-pwd:...
+//	m=video 9 UDP/TLS/RTP/SAVPF 96
+//	a=mid:1
+//	a=candidate:1 1 udp 2130706431 10.0.0.1 5000 typ host
+//	a=end-of-candidates
+//
+// so each "a=candidate:" line is tagged with the SDPMid/SDPMLineIndex of the
+// nearest preceding "a=mid:"/"m=" line.
+func parseTrickleFragment(frag []byte) (candidates []webrtc.ICECandidateInit, endOfCandidates bool) {
+	var mid string
+	var mLineIndex uint16
+	sawMLine := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(frag))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "m="):
+			if sawMLine {
+				mLineIndex++
+			}
+			sawMLine = true
+
+		case strings.HasPrefix(line, "a=mid:"):
+			mid = strings.TrimPrefix(line, "a=mid:")
+
+		case strings.HasPrefix(line, "a=end-of-candidates"):
+			endOfCandidates = true
+
+		case strings.HasPrefix(line, "a=candidate:"):
+			candidateMid, candidateMLineIndex := mid, mLineIndex
+			candidates = append(candidates, webrtc.ICECandidateInit{
+				Candidate:     strings.TrimPrefix(line, "a="),
+				SDPMid:        &candidateMid,
+				SDPMLineIndex: &candidateMLineIndex,
+			})
+		}
+	}
+	return candidates, endOfCandidates
+}
+
+// patchCandidate applies the ICE candidates trickled in an
+// application/trickle-ice-sdpfrag body to an existing WHIP/WHEP resource.
+func patchCandidate(w http.ResponseWriter, r *http.Request, id string) {
+	res, ok := lookupResource(id)
+	if !ok {
+		http.Error(w, "unknown resource", http.StatusNotFound)
+		return
+	}
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && ifMatch != res.etag {
+		http.Error(w, "ETag mismatch", http.StatusPreconditionFailed)
+		return
+	}
+	if ct := r.Header.Get("Content-Type"); ct != "application/trickle-ice-sdpfrag" {
+		http.Error(w, "expected Content-Type: application/trickle-ice-sdpfrag", http.StatusUnsupportedMediaType)
+		return
+	}
+	frag, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "failed to read candidate fragment", http.StatusBadRequest)
+		return
+	}
+
+	candidates, endOfCandidates := parseTrickleFragment(frag)
+	for _, ci := range candidates {
+		if err := res.pc.AddICECandidate(ci); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if endOfCandidates {
+		if err := res.pc.AddICECandidate(webrtc.ICECandidateInit{}); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// teardownResource closes the PeerConnection behind a DELETE'd WHIP/WHEP resource.
+func teardownResource(w http.ResponseWriter, r *http.Request, id string) {
+	res, ok := lookupResource(id)
+	if !ok {
+		http.Error(w, "unknown resource", http.StatusNotFound)
+		return
+	}
+	removeResource(id)
+	res.pc.Close()
+	log.Printf("Resource %s torn down", id)
+	w.WriteHeader(http.StatusOK)
+}